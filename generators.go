@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// MetricGenerator produces a single synthetic metric payload. Implementations
+// are registered with a metricsRegistry and selected via weighted random
+// choice.
+type MetricGenerator interface {
+	// Type returns the metric's "type" field, as rendered in the metrics
+	// envelope.
+	Type() string
+	// Generate produces a payload for a single sample, drawing randomness
+	// from rnd.
+	Generate(rnd *rand.Rand) interface{}
+}
+
+// metricsRegistry holds the set of MetricGenerators available to a metrics
+// handler, each with a relative weight controlling how often it is picked.
+type metricsRegistry struct {
+	generators []MetricGenerator
+	weights    []float64
+	total      float64
+}
+
+// newMetricsRegistry returns a registry pre-populated with the three
+// built-in generators.
+func newMetricsRegistry() *metricsRegistry {
+	reg := &metricsRegistry{}
+	reg.Register(loadAvgGenerator{}, 1)
+	reg.Register(cpuUsageGenerator{}, 1)
+	reg.Register(lastKernelUpgradeGenerator{}, 1)
+	return reg
+}
+
+// Register adds g to the registry with the given relative weight.
+func (r *metricsRegistry) Register(g MetricGenerator, weight float64) {
+	r.generators = append(r.generators, g)
+	r.weights = append(r.weights, weight)
+	r.total += weight
+}
+
+// Pick selects a generator at random, weighted by the registered weights.
+func (r *metricsRegistry) Pick(rnd *rand.Rand) MetricGenerator {
+	target := rnd.Float64() * r.total
+	for i, w := range r.weights {
+		target -= w
+		if target <= 0 {
+			return r.generators[i]
+		}
+	}
+	return r.generators[len(r.generators)-1]
+}
+
+// metricsSource generates metricsEnvelopes from a shared registry using a
+// single, optionally-seeded random source. *rand.Rand is not safe for
+// concurrent use, so access is serialized with a mutex.
+type metricsSource struct {
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	registry *metricsRegistry
+}
+
+// newMetricsSource returns a metricsSource reading from registry, seeded
+// with seed.
+func newMetricsSource(registry *metricsRegistry, seed int64) *metricsSource {
+	return &metricsSource{
+		rnd:      rand.New(rand.NewSource(seed)),
+		registry: registry,
+	}
+}
+
+// Next generates a single random metric envelope.
+func (s *metricsSource) Next() metricsEnvelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.registry.Pick(s.rnd)
+	return metricsEnvelope{Type: g.Type(), Payload: g.Generate(s.rnd)}
+}
+
+// Int31n returns, under the source's lock, a random int32 in [0, n).
+func (s *metricsSource) Int31n(n int32) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Int31n(n)
+}
+
+// loadAvgGenerator is the built-in "load_avg" generator.
+type loadAvgGenerator struct{}
+
+func (loadAvgGenerator) Type() string { return "load_avg" }
+
+func (loadAvgGenerator) Generate(rnd *rand.Rand) interface{} {
+	return loadAvgMetric{Value: rnd.Float32()}
+}
+
+// cpuUsageGenerator is the built-in "cpu_usage" generator.
+type cpuUsageGenerator struct{}
+
+func (cpuUsageGenerator) Type() string { return "cpu_usage" }
+
+func (cpuUsageGenerator) Generate(rnd *rand.Rand) interface{} {
+	values := make([]float32, 5)
+	for i := range values {
+		values[i] = rnd.Float32()
+	}
+	return cpuUsageMetric{Value: values}
+}
+
+// lastKernelUpgradeGenerator is the built-in "last_kernel_upgrade" generator.
+type lastKernelUpgradeGenerator struct{}
+
+func (lastKernelUpgradeGenerator) Type() string { return "last_kernel_upgrade" }
+
+func (lastKernelUpgradeGenerator) Generate(_ *rand.Rand) interface{} {
+	return lastKernelUpgrade{Value: time.Now()}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// demowareServer bundles the shared http.Server with the goroutines serving
+// each of its listeners so shutdown can wait for all of them to drain.
+type demowareServer struct {
+	http         *http.Server
+	group        *errgroup.Group
+	tlsWatchDone chan struct{}
+}
+
+// Shutdown gracefully stops all listeners and waits for their Serve
+// goroutines to return, bounded by ctx.
+func (s *demowareServer) Shutdown(ctx context.Context) error {
+	if s.tlsWatchDone != nil {
+		close(s.tlsWatchDone)
+	}
+	if err := s.http.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.group.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startServer creates the shared http.Server and spins up one listener per
+// configured --listen-address / --listen-tls-address entry, all backed by
+// the same handler and drained cooperatively on shutdown.
+func startServer(cliCtx *cli.Context, mux http.Handler) (*demowareServer, error) {
+	var (
+		listenAddrs     = cliCtx.StringSlice("listen-address")
+		tlsListenAddrs  = cliCtx.StringSlice("listen-tls-address")
+		tlsCertFile     = cliCtx.String("listen-tls-key")
+		tlsKeyFile      = cliCtx.String("listen-tls-password")
+		tlsClientCAFile = cliCtx.String("listen-tls-client-ca")
+	)
+
+	if len(tlsListenAddrs) == 0 && (tlsCertFile != "" || tlsKeyFile != "" || tlsClientCAFile != "") {
+		return nil, xerrors.Errorf("--listen-tls-key, --listen-tls-password and --listen-tls-client-ca require --listen-tls-address to be set")
+	}
+
+	srv := &http.Server{Handler: mux}
+	dsrv := &demowareServer{http: srv, group: new(errgroup.Group)}
+
+	for _, addr := range listenAddrs {
+		l, err := newListener(addr)
+		if err != nil {
+			return nil, err
+		}
+		dsrv.group.Go(func() error {
+			doServe(srv, l, false)
+			return nil
+		})
+	}
+
+	if len(tlsListenAddrs) > 0 {
+		if tlsCertFile == "" || tlsKeyFile == "" {
+			return nil, xerrors.Errorf("--listen-tls-address requires --listen-tls-key and --listen-tls-password to be set")
+		}
+
+		reloader, err := newTLSReloader(tlsCertFile, tlsKeyFile, tlsClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = buildTLSConfig(reloader)
+		dsrv.tlsWatchDone = make(chan struct{})
+		go reloader.watch(dsrv.tlsWatchDone)
+
+		for _, addr := range tlsListenAddrs {
+			l, err := newListener(addr)
+			if err != nil {
+				return nil, err
+			}
+			dsrv.group.Go(func() error {
+				doServe(srv, l, true)
+				return nil
+			})
+		}
+	}
+
+	return dsrv, nil
+}
+
+// newListener creates a net.Listener for addr, which is either a "host:port"
+// TCP address or a "unix://" URL naming a unix domain socket. Unix sockets
+// are created with 0600 permissions, and any stale socket file left behind
+// by a previous run is removed first.
+func newListener(addr string) (net.Listener, error) {
+	network, address := parseListenAddress(addr)
+	if network != "unix" {
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to create listener for %q: %w", addr, err)
+		}
+		return l, nil
+	}
+
+	_ = os.Remove(address)
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to create unix socket listener at %q: %w", address, err)
+	}
+	if err := os.Chmod(address, 0600); err != nil {
+		return nil, xerrors.Errorf("unable to set permissions on unix socket %q: %w", address, err)
+	}
+	return l, nil
+}
+
+// parseListenAddress splits a --listen-address value into a net.Listen
+// network and address, recognizing the "unix://" scheme for domain sockets.
+func parseListenAddress(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix://") {
+		return "unix", strings.TrimPrefix(addr, "unix://")
+	}
+	return "tcp", addr
+}
+
+// doServe starts serving incoming API requests on l.
+func doServe(srv *http.Server, l net.Listener, useTLS bool) {
+	appLogger.WithFields(logrus.Fields{
+		"use_tls":   useTLS,
+		"listen_at": l.Addr().String(),
+	}).Info("listening for incoming connections")
+
+	if useTLS {
+		_ = srv.ServeTLS(l, "", "")
+	} else {
+		_ = srv.Serve(l)
+	}
+}
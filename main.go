@@ -2,10 +2,8 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"math/rand"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -29,13 +27,18 @@ func main() {
 		Name:  "demoware",
 		Usage: "A minimal test server that simulates a poll-able metrics stream",
 		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "listen-address", Value: ":8080", Usage: "the address to listen for incoming API connections"},
+			&cli.StringSliceFlag{Name: "listen-address", Value: cli.NewStringSlice(":8080"), Usage: "the address to listen for incoming API connections; may be repeated, and accepts unix:///path/to.sock in addition to host:port"},
+			&cli.StringSliceFlag{Name: "listen-tls-address", Usage: "same as --listen-address but serves TLS on this listener; may be repeated"},
 			&cli.StringFlag{Name: "listen-tls-key", Value: "", Usage: "path to a file with a TLS cert for the server (enables TLS support)"},
 			&cli.StringFlag{Name: "listen-tls-password", Value: "", Usage: "path to the TLS key for the server (enables TLS support)"},
+			&cli.StringFlag{Name: "listen-tls-client-ca", Value: "", Usage: "path to a PEM bundle of CAs to verify client certificates against (enables mutual TLS)"},
 			// Options for metrics generation
 			&cli.StringFlag{Name: "metrics-endpoint", Value: "/metrics", Usage: "endpoint for serving metrics requests"},
 			&cli.UintFlag{Name: "metrics-min-count", Value: 0, Usage: "minimum number of metrics to return in responses"},
 			&cli.UintFlag{Name: "metrics-max-count", Value: 10, Usage: "maximum number of metrics to return in responses"},
+			&cli.DurationFlag{Name: "stream-interval", Value: time.Second, Usage: "interval between metric envelopes pushed to /metrics/stream subscribers"},
+			&cli.StringFlag{Name: "metrics-config", Value: "", Usage: "path to a YAML/JSON file describing additional synthetic metric generators"},
+			&cli.Int64Flag{Name: "metrics-seed", Usage: "seed for the metrics random generator, for reproducible test runs (default: random)"},
 			// Injectable options
 			&cli.StringFlag{Name: "with-auth-token", Value: "", Usage: "if specified, require clients to provide basic auth token"},
 			&cli.Float64Flag{Name: "with-random-error-prob", Value: 0, Usage: "if non-zero, inject errors based on the given probability"},
@@ -68,59 +71,14 @@ func demowareApp(cliCtx *cli.Context) error {
 	return nil
 }
 
-// startServer creates a new http.Server instance using the configuration
-// settings from the provided CLI context and spins up a goroutine to handle
-// incoming connections.
-func startServer(cliCtx *cli.Context, mux http.Handler) (*http.Server, error) {
-	var (
-		listenAt    = cliCtx.String("listen-address")
-		tlsCertFile = cliCtx.String("listen-tls-key")
-		tlsKeyFile  = cliCtx.String("listen-tlk-password")
-		srv         = &http.Server{Handler: mux}
-	)
-
-	l, err := net.Listen("tcp", listenAt)
-	if err != nil {
-		return nil, xerrors.Errorf("unable to create listener: %w", err)
-	}
-
-	if tlsCertFile != "" && tlsKeyFile != "" {
-		cert, certErr := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
-		if certErr != nil {
-			return nil, xerrors.Errorf("unable to load TLS certificate: %w", certErr)
-		}
-
-		srv.TLSConfig = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
-	}
-
-	go doServe(srv, l)
-	return srv, err
-}
-
-// doServe starts serving incoming API requests.
-func doServe(srv *http.Server, l net.Listener) {
-	useTLS := srv.TLSConfig != nil
-	appLogger.WithFields(logrus.Fields{
-		"use_tls":   srv.TLSConfig != nil,
-		"listen_at": l.Addr().String(),
-	}).Info("listening for incoming connections")
-
-	if useTLS {
-		_ = srv.ServeTLS(l, "", "")
-	} else {
-		_ = srv.Serve(l)
-	}
-}
-
 // signalAwareContext returns a context.Context that gets cancelled when the
-// process receives a HUP or INT signal.
+// process receives an INT or TERM signal. SIGHUP is deliberately left alone
+// here since it is used to trigger a TLS certificate reload instead.
 func signalAwareContext(ctx context.Context) context.Context {
 	wrappedCtx, cancelFn := context.WithCancel(ctx)
 	go func() {
 		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		s := <-sigCh
 		appLogger.WithField("signal", s.String()).Info("terminating due to signal")
 		cancelFn()
@@ -152,29 +110,57 @@ type lastKernelUpgrade struct {
 	Value time.Time `json:"value"`
 }
 
-// registerMetricsHandler registers a handler for the metrics endpoint with
-// the provided ServeMux.
+// registerMetricsHandler registers handlers for the metrics endpoint and its
+// streaming counterpart with the provided ServeMux.
 func registerMetricsHandler(cliCtx *cli.Context, mux *http.ServeMux) {
 	endpoint := cliCtx.String("metrics-endpoint")
-	h := genMetricsHandler(cliCtx)
+	token := cliCtx.String("with-auth-token")
+	failProb := cliCtx.Float64("with-random-error-prob")
 
-	// Wrap base handler with additional middleware
-	if token := cliCtx.String("with-auth-token"); token != "" {
+	registry := newMetricsRegistry()
+	if cfgPath := cliCtx.String("metrics-config"); cfgPath != "" {
+		if err := loadMetricsConfig(cfgPath, registry); err != nil {
+			exitWithError(xerrors.Errorf("unable to load metrics config: %w", err))
+		}
+		appLogger.WithField("config", cfgPath).Info("loaded additional metric generators")
+	}
+
+	seed := time.Now().UnixNano()
+	if cliCtx.IsSet("metrics-seed") {
+		seed = cliCtx.Int64("metrics-seed")
+	}
+	source := newMetricsSource(registry, seed)
+
+	h := genMetricsHandler(cliCtx, source)
+	if token != "" {
 		h = injectAuthMiddleware(h, token)
 		appLogger.WithField("auth_token", token).Info("enabling authentication for incoming requests")
 	}
-	if failProb := cliCtx.Float64("with-random-error-prob"); failProb != 0 {
+	if failProb != 0 {
 		h = injectRandomErrorMiddleware(h, failProb)
 		appLogger.WithField("fail_prob", failProb).Info("enabling random fail injector for incoming requests")
 	}
-
-	mux.Handle(endpoint, h)
+	mux.Handle(endpoint, requestIDMiddleware(h))
 	appLogger.WithField("endpoint", endpoint).Info("registered metrics handler")
+
+	streamEndpoint := endpoint + "/stream"
+	// The stream endpoint gets its own fail-injection handling: unlike the
+	// polled endpoint above, a failure here should be able to land at any
+	// tick of an already-open stream, not just at connection time, so it's
+	// threaded through to genMetricsStreamHandler instead of wrapped with
+	// injectRandomErrorMiddleware.
+	sh := genMetricsStreamHandler(cliCtx, source, failProb)
+	if token != "" {
+		sh = injectAuthMiddleware(sh, token)
+	}
+	mux.Handle(streamEndpoint, requestIDMiddleware(sh))
+	appLogger.WithField("endpoint", streamEndpoint).Info("registered metrics stream handler")
 }
 
-// registerMetricsHandler generates a handler for the metrics endpoint that is
-// parametrized by the contents of the provided CLI context.
-func genMetricsHandler(cliCtx *cli.Context) http.Handler {
+// genMetricsHandler generates a handler for the metrics endpoint that is
+// parametrized by the contents of the provided CLI context, drawing metrics
+// from source.
+func genMetricsHandler(cliCtx *cli.Context, source *metricsSource) http.Handler {
 	minMetrics := int32(cliCtx.Uint("metrics-min-count"))
 	maxMetrics := int32(cliCtx.Uint("metrics-max-count"))
 	if minMetrics > maxMetrics {
@@ -182,39 +168,22 @@ func genMetricsHandler(cliCtx *cli.Context) http.Handler {
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		numMetrics := rand.Int31n(maxMetrics-minMetrics) + minMetrics
+		numMetrics := minMetrics
+		if span := maxMetrics - minMetrics; span > 0 {
+			numMetrics += source.Int31n(span)
+		}
 		metricsList := make([]metricsEnvelope, numMetrics)
 		for i := int32(0); i < numMetrics; i++ {
-			switch rand.Int31n(3) {
-			case 0:
-				metricsList[i].Type = "load_avg"
-				metricsList[i].Payload = loadAvgMetric{
-					Value: rand.Float32(),
-				}
-			case 1:
-				metricsList[i].Type = "cpu_usage"
-				values := make([]float32, 5)
-				for i := 0; i < len(values); i++ {
-					values[i] = rand.Float32()
-				}
-				metricsList[i].Payload = cpuUsageMetric{
-					Value: values,
-				}
-			case 2:
-				metricsList[i].Type = "last_kernel_upgrade"
-				metricsList[i].Payload = lastKernelUpgrade{
-					Value: time.Now(),
-				}
-			}
+			metricsList[i] = source.Next()
 		}
 
 		// Serialize response
 		if err := json.NewEncoder(w).Encode(metricsList); err != nil {
-			appLogger.WithError(err).Error("GET ", r.URL.Path)
+			requestLogger(r.Context()).WithError(err).Error("GET ", r.URL.Path)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		appLogger.WithField("num_metrics", numMetrics).Info("GET ", r.URL.Path)
+		requestLogger(r.Context()).WithField("num_metrics", numMetrics).Info("GET ", r.URL.Path)
 	})
 }
 
@@ -226,7 +195,7 @@ func injectAuthMiddleware(h http.Handler, token string) http.Handler {
 		user, _, ok := r.BasicAuth()
 		if !ok || user != token {
 			w.WriteHeader(http.StatusUnauthorized)
-			appLogger.WithError(xerrors.Errorf("authentication failed")).Error("GET ", r.URL.Path)
+			requestLogger(r.Context()).WithError(xerrors.Errorf("authentication failed")).Error("GET ", r.URL.Path)
 			return
 		}
 
@@ -234,16 +203,25 @@ func injectAuthMiddleware(h http.Handler, token string) http.Handler {
 	})
 }
 
-// injectRandomErrorMiddleware wraps h with a middleware that injects errors
-// with the specified probability.
-func injectRandomErrorMiddleware(h http.Handler, prob float64) http.Handler {
+// validateErrorProb checks that prob is a valid injection probability,
+// exiting the process with an error if not. It is shared by the polled and
+// streaming fail-injection paths so both reject the same malformed input.
+func validateErrorProb(prob float64) {
 	if prob < 0 || prob > 1 {
 		exitWithError(xerrors.Errorf("random error probability must be in the (0, 1] range"))
 	}
+}
+
+// injectRandomErrorMiddleware wraps h with a middleware that responds with a
+// 500 with the specified probability, as appropriate for one-shot
+// request/response handlers. Streaming handlers inject their own failures
+// per tick instead; see genMetricsStreamHandler.
+func injectRandomErrorMiddleware(h http.Handler, prob float64) http.Handler {
+	validateErrorProb(prob)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if rand.Float64() <= prob {
 			w.WriteHeader(http.StatusInternalServerError)
-			appLogger.WithError(xerrors.Errorf("injected error")).Error("GET ", r.URL.Path)
+			requestLogger(r.Context()).WithError(xerrors.Errorf("injected error")).Error("GET ", r.URL.Path)
 			return
 		}
 
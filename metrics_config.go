@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// metricFieldSpec describes how to synthesize a single field of a
+// user-defined metric payload, as parsed from a --metrics-config file.
+type metricFieldSpec struct {
+	Kind    string   `yaml:"kind"`
+	Min     float64  `yaml:"min,omitempty"`
+	Max     float64  `yaml:"max,omitempty"`
+	Choices []string `yaml:"choices,omitempty"`
+	Length  int      `yaml:"length,omitempty"`
+}
+
+// metricConfigEntry describes one user-defined metric generator, as parsed
+// from a --metrics-config file.
+type metricConfigEntry struct {
+	Type   string                     `yaml:"type"`
+	Weight float64                    `yaml:"weight"`
+	Fields map[string]metricFieldSpec `yaml:"fields"`
+}
+
+// configuredGenerator is a MetricGenerator compiled from a
+// metricConfigEntry. Each field's sampling function is pre-built at load
+// time so Generate does no further parsing at request time.
+type configuredGenerator struct {
+	typeName string
+	fields   map[string]func(*rand.Rand) interface{}
+}
+
+func (g *configuredGenerator) Type() string { return g.typeName }
+
+func (g *configuredGenerator) Generate(rnd *rand.Rand) interface{} {
+	payload := make(map[string]interface{}, len(g.fields))
+	for name, sample := range g.fields {
+		payload[name] = sample(rnd)
+	}
+	return payload
+}
+
+// loadMetricsConfig reads a YAML (or JSON, which parses as YAML) file
+// describing additional synthetic metrics and registers a compiled
+// generator for each entry into reg.
+func loadMetricsConfig(path string, reg *metricsRegistry) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return xerrors.Errorf("unable to read metrics config %q: %w", path, err)
+	}
+
+	var entries []metricConfigEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return xerrors.Errorf("unable to parse metrics config %q: %w", path, err)
+	}
+
+	for _, entry := range entries {
+		if entry.Weight <= 0 {
+			return xerrors.Errorf("invalid metrics config entry %q: weight must be > 0", entry.Type)
+		}
+		gen, err := compileMetricGenerator(entry)
+		if err != nil {
+			return xerrors.Errorf("invalid metrics config entry %q: %w", entry.Type, err)
+		}
+		reg.Register(gen, entry.Weight)
+	}
+	return nil
+}
+
+// compileMetricGenerator compiles a single config entry into a
+// MetricGenerator.
+func compileMetricGenerator(entry metricConfigEntry) (MetricGenerator, error) {
+	if entry.Type == "" {
+		return nil, xerrors.Errorf("missing \"type\"")
+	}
+
+	fields := make(map[string]func(*rand.Rand) interface{}, len(entry.Fields))
+	for name, spec := range entry.Fields {
+		sample, err := compileFieldSpec(spec)
+		if err != nil {
+			return nil, xerrors.Errorf("field %q: %w", name, err)
+		}
+		fields[name] = sample
+	}
+	return &configuredGenerator{typeName: entry.Type, fields: fields}, nil
+}
+
+// compileFieldSpec compiles a single field spec into a sampling function.
+func compileFieldSpec(spec metricFieldSpec) (func(*rand.Rand) interface{}, error) {
+	switch spec.Kind {
+	case "float_range":
+		min, max := spec.Min, spec.Max
+		return func(rnd *rand.Rand) interface{} {
+			return min + rnd.Float64()*(max-min)
+		}, nil
+	case "int_range":
+		min, max := int(spec.Min), int(spec.Max)
+		if max < min {
+			return nil, xerrors.Errorf("int_range field requires max >= min")
+		}
+		return func(rnd *rand.Rand) interface{} {
+			return min + rnd.Intn(max-min+1)
+		}, nil
+	case "enum":
+		if len(spec.Choices) == 0 {
+			return nil, xerrors.Errorf("enum field requires at least one choice")
+		}
+		choices := spec.Choices
+		return func(rnd *rand.Rand) interface{} {
+			return choices[rnd.Intn(len(choices))]
+		}, nil
+	case "timestamp_now":
+		return func(*rand.Rand) interface{} {
+			return time.Now()
+		}, nil
+	case "float_array":
+		if spec.Length <= 0 {
+			return nil, xerrors.Errorf("float_array field requires a positive length")
+		}
+		length := spec.Length
+		return func(rnd *rand.Rand) interface{} {
+			values := make([]float64, length)
+			for i := range values {
+				values[i] = rnd.Float64()
+			}
+			return values
+		}, nil
+	default:
+		return nil, xerrors.Errorf("unknown field kind %q", spec.Kind)
+	}
+}
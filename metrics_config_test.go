@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileFieldSpecRejectsInvertedIntRange(t *testing.T) {
+	_, err := compileFieldSpec(metricFieldSpec{Kind: "int_range", Min: 10, Max: 5})
+	if err == nil {
+		t.Fatal("expected an error for max < min, got nil")
+	}
+}
+
+func TestCompileFieldSpecAcceptsIntRange(t *testing.T) {
+	sample, err := compileFieldSpec(metricFieldSpec{Kind: "int_range", Min: 5, Max: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rnd := newMetricsSource(newMetricsRegistry(), 1).rnd
+	for i := 0; i < 100; i++ {
+		v := sample(rnd).(int)
+		if v < 5 || v > 10 {
+			t.Fatalf("sampled value %d out of [5, 10] range", v)
+		}
+	}
+}
+
+func TestLoadMetricsConfigRejectsNonPositiveWeight(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.yaml")
+	contents := `
+- type: custom_metric
+  weight: 0
+  fields:
+    value:
+      kind: float_range
+      min: 0
+      max: 1
+`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	reg := newMetricsRegistry()
+	if err := loadMetricsConfig(path, reg); err == nil {
+		t.Fatal("expected an error for a zero weight, got nil")
+	}
+}
+
+func TestLoadMetricsConfigRejectsInvertedIntRange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.yaml")
+	contents := `
+- type: custom_metric
+  weight: 1
+  fields:
+    value:
+      kind: int_range
+      min: 10
+      max: 5
+`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	reg := newMetricsRegistry()
+	if err := loadMetricsConfig(path, reg); err == nil {
+		t.Fatal("expected an error for an inverted int_range, got nil")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// streamEnvelope is a single tick of the metrics stream. It embeds
+// metricsEnvelope so subscribers see the same "type"/"payload" shape as the
+// polled /metrics endpoint, plus a monotonically increasing sequence number
+// that lets SSE clients resume with Last-Event-ID.
+type streamEnvelope struct {
+	Seq uint64 `json:"seq"`
+	metricsEnvelope
+}
+
+var wsUpgrader = websocket.Upgrader{
+	// Demo server; any origin is accepted so the stream is easy to exercise
+	// from a browser console or a standalone test client.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// genMetricsStreamHandler returns a handler for the streaming metrics
+// endpoint. It content-negotiates between Server-Sent Events and a
+// WebSocket upgrade and pushes one streamEnvelope per tick until the client
+// disconnects. If failProb is non-zero, each tick has that probability of
+// instead closing the connection abruptly, so client libraries can be
+// tested against a mid-stream drop.
+func genMetricsStreamHandler(cliCtx *cli.Context, source *metricsSource, failProb float64) http.Handler {
+	interval := cliCtx.Duration("stream-interval")
+	if failProb != 0 {
+		validateErrorProb(failProb)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			serveMetricsWebSocket(w, r, interval, source, failProb)
+			return
+		}
+		serveMetricsSSE(w, r, interval, source, failProb)
+	})
+}
+
+// serveMetricsSSE streams metrics as Server-Sent Events, framing each
+// envelope with "id:" / "event: metric" lines so clients can resume with
+// Last-Event-ID.
+func serveMetricsSSE(w http.ResponseWriter, r *http.Request, interval time.Duration, source *metricsSource, failProb float64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var seq uint64
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if n, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+			seq = n + 1
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			requestLogger(r.Context()).Info("GET ", r.URL.Path, " (client disconnected)")
+			return
+		case <-ticker.C:
+			if failProb != 0 && rand.Float64() <= failProb {
+				abruptlyCloseSSE(w, r)
+				return
+			}
+			env := streamEnvelope{Seq: seq, metricsEnvelope: source.Next()}
+			payload, err := json.Marshal(env)
+			if err != nil {
+				requestLogger(r.Context()).WithError(err).Error("GET ", r.URL.Path)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: metric\ndata: %s\n\n", seq, payload)
+			flusher.Flush()
+			seq++
+		}
+	}
+}
+
+// abruptlyCloseSSE hijacks the underlying connection and closes it without
+// writing anything further, simulating a broken connection mid-stream.
+func abruptlyCloseSSE(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		requestLogger(r.Context()).WithError(err).Error("GET ", r.URL.Path, " (abrupt close failed)")
+		return
+	}
+	requestLogger(r.Context()).WithError(xerrors.Errorf("injected error")).Error("GET ", r.URL.Path, " (abrupt close)")
+	_ = conn.Close()
+}
+
+// serveMetricsWebSocket streams metrics over a WebSocket connection,
+// writing one JSON-encoded streamEnvelope per tick.
+func serveMetricsWebSocket(w http.ResponseWriter, r *http.Request, interval time.Duration, source *metricsSource, failProb float64) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		requestLogger(r.Context()).WithError(err).Error("GET ", r.URL.Path, " (websocket upgrade failed)")
+		return
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var seq uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			requestLogger(r.Context()).Info("GET ", r.URL.Path, " (client disconnected)")
+			return
+		case <-ticker.C:
+			if failProb != 0 && rand.Float64() <= failProb {
+				requestLogger(r.Context()).WithError(xerrors.Errorf("injected error")).Error("GET ", r.URL.Path, " (abrupt close)")
+				_ = conn.Close()
+				return
+			}
+			env := streamEnvelope{Seq: seq, metricsEnvelope: source.Next()}
+			if err := conn.WriteJSON(env); err != nil {
+				requestLogger(r.Context()).WithError(err).Error("GET ", r.URL.Path, " (websocket write failed)")
+				return
+			}
+			seq++
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/xerrors"
+)
+
+// tlsReloader watches a certificate/key pair (and, optionally, a client CA
+// bundle) on disk and atomically swaps in newly written versions without
+// requiring a server restart. Reloads are triggered either by a filesystem
+// event on the watched paths or by a SIGHUP.
+type tlsReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	cert     atomic.Value // holds tls.Certificate
+	clientCA atomic.Value // holds *x509.CertPool
+}
+
+// newTLSReloader loads the initial certificate/key pair (and client CA
+// bundle, if provided) and returns a tlsReloader ready to be watched.
+func newTLSReloader(certFile, keyFile, clientCAFile string) (*tlsReloader, error) {
+	r := &tlsReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to load TLS certificate: %w", err)
+	}
+	r.cert.Store(cert)
+
+	if clientCAFile != "" {
+		pool, err := loadClientCAPool(clientCAFile)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to load TLS client CA bundle: %w", err)
+		}
+		r.clientCA.Store(pool)
+	}
+
+	return r, nil
+}
+
+// GetCertificate implements the tls.Config.GetCertificate hook so incoming
+// handshakes always observe the most recently loaded certificate.
+func (r *tlsReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := r.cert.Load().(tls.Certificate)
+	return &cert, nil
+}
+
+// clientCAPool returns the currently loaded client CA pool, or nil if client
+// certificate verification is not configured.
+func (r *tlsReloader) clientCAPool() *x509.CertPool {
+	pool, _ := r.clientCA.Load().(*x509.CertPool)
+	return pool
+}
+
+// watch blocks, reloading the certificate (and client CA bundle) whenever
+// the watched files change or the process receives a SIGHUP. It returns once
+// the provided done channel is closed.
+func (r *tlsReloader) watch(done <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		appLogger.WithError(err).Warn("unable to start TLS file watcher; hot reload disabled")
+		return
+	}
+	defer watcher.Close()
+
+	for _, dir := range r.watchedDirs() {
+		if err := watcher.Add(dir); err != nil {
+			appLogger.WithError(err).WithField("dir", dir).Warn("unable to watch directory for TLS changes")
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-sigCh:
+			r.reload()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if r.isWatchedFile(event.Name) {
+				r.reload()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			appLogger.WithError(err).Warn("TLS file watcher error")
+		}
+	}
+}
+
+// watchedDirs returns the distinct directories containing the files this
+// reloader cares about, since fsnotify watches directories rather than
+// individual files (so it still sees atomic rename-based rewrites).
+func (r *tlsReloader) watchedDirs() []string {
+	seen := map[string]struct{}{}
+	var dirs []string
+	for _, f := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if f == "" {
+			continue
+		}
+		dir := filepath.Dir(f)
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (r *tlsReloader) isWatchedFile(name string) bool {
+	for _, f := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if f != "" && filepath.Clean(name) == filepath.Clean(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload re-reads the certificate/key pair and client CA bundle from disk
+// and swaps them in on success. A bad file on disk must never take down a
+// running server, so any error is logged at warn and the previously loaded
+// material is left in place.
+func (r *tlsReloader) reload() {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		appLogger.WithError(err).Warn("failed to reload TLS certificate; keeping previous certificate")
+	} else {
+		r.cert.Store(cert)
+		appLogger.Info("reloaded TLS certificate")
+	}
+
+	if r.clientCAFile == "" {
+		return
+	}
+	pool, err := loadClientCAPool(r.clientCAFile)
+	if err != nil {
+		appLogger.WithError(err).Warn("failed to reload TLS client CA bundle; keeping previous trust roots")
+		return
+	}
+	r.clientCA.Store(pool)
+	appLogger.Info("reloaded TLS client CA bundle")
+}
+
+// loadClientCAPool reads a PEM bundle from path and returns it as an
+// x509.CertPool suitable for tls.Config.ClientCAs.
+func loadClientCAPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, xerrors.Errorf("no certificates found in client CA bundle %q", path)
+	}
+	return pool, nil
+}
+
+// buildTLSConfig assembles a *tls.Config backed by the reloader so that
+// certificate rotation (and, if configured, client CA rotation) take effect
+// without dropping in-flight connections.
+func buildTLSConfig(r *tlsReloader) *tls.Config {
+	cfg := &tls.Config{
+		GetCertificate: r.GetCertificate,
+	}
+	if r.clientCAFile != "" {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.GetConfigForClient = func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			clone := cfg.Clone()
+			clone.GetConfigForClient = nil
+			clone.ClientCAs = r.clientCAPool()
+			return clone, nil
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a freshly generated self-signed certificate and
+// key pair to certPath/keyPath, for use as TLS test fixtures.
+func writeSelfSignedCert(t *testing.T, certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "demoware-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	certOut, err := os.Create(certPath)
+	if err != nil {
+		t.Fatalf("create cert file: %v", err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("encode cert: %v", err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyOut, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatalf("create key file: %v", err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}); err != nil {
+		t.Fatalf("encode key: %v", err)
+	}
+}
+
+// TestTLSReloaderReloadKeepsPreviousCertOnError verifies the safety contract
+// documented on reload: a corrupt cert/key on disk must never take down the
+// running server, so the previously loaded certificate stays in place.
+func TestTLSReloaderReloadKeepsPreviousCertOnError(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "server.crt")
+	keyPath := filepath.Join(dir, "server.key")
+	writeSelfSignedCert(t, certPath, keyPath)
+
+	r, err := newTLSReloader(certPath, keyPath, "")
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+	original := certLeafBytes(r)
+
+	if err := os.WriteFile(certPath, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatalf("corrupt cert file: %v", err)
+	}
+
+	r.reload()
+
+	if !bytes.Equal(certLeafBytes(r), original) {
+		t.Fatalf("reload() swapped in a certificate after a load failure; previous certificate was discarded")
+	}
+}
+
+// certLeafBytes returns the raw DER bytes of r's currently loaded leaf
+// certificate, for comparing successive loads (tls.Certificate itself is
+// not comparable).
+func certLeafBytes(r *tlsReloader) []byte {
+	cert := r.cert.Load().(tls.Certificate)
+	return cert.Certificate[0]
+}
+
+// TestTLSReloaderReloadSwapsValidCert verifies the happy path: a newly
+// written, valid certificate is picked up on reload.
+func TestTLSReloaderReloadSwapsValidCert(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "server.crt")
+	keyPath := filepath.Join(dir, "server.key")
+	writeSelfSignedCert(t, certPath, keyPath)
+
+	r, err := newTLSReloader(certPath, keyPath, "")
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+	original := certLeafBytes(r)
+
+	writeSelfSignedCert(t, certPath, keyPath)
+	r.reload()
+
+	if bytes.Equal(certLeafBytes(r), original) {
+		t.Fatalf("reload() kept the old certificate after a valid rewrite")
+	}
+}